@@ -0,0 +1,315 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// promType is a metric family's declared "# TYPE", used to decide how its
+// samples map onto stats.MetricType/Submetrics below.
+type promType int
+
+const (
+	promUntyped promType = iota
+	promCounter
+	promGauge
+	promHistogram
+	promSummary
+)
+
+// ParseText parses metric exposition in the Prometheus/OpenMetrics text
+// format (as served by a typical /metrics endpoint) into Samples, so a
+// script can scrape a target system mid-test and have the result flow
+// through the same collectors as its HTTP metrics.
+//
+// Metrics are auto-registered in reg on first sight, using the
+// MetricType implied by their "# TYPE" line (untyped families default to
+// Gauge). Histogram and summary families have no single equivalent
+// stats.MetricType, so each of their bucket/quantile series is expanded
+// into its own submetric via NewSubmetric, keyed by the family name plus
+// its "le"/"quantile" label - e.g. "http_req_duration{le:0.5}".
+func ParseText(r io.Reader, reg *Registry) ([]Sample, error) {
+	types := map[string]promType{}
+	samples := []Sample{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			if typ, name, ok := parseTypeComment(line); ok {
+				types[name] = typ
+			}
+			continue
+		}
+
+		name, labels, value, ts, err := parseSampleLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("stats: malformed exposition line %q: %w", line, err)
+		}
+
+		sample, err := sampleFor(reg, types, name, labels, value, ts)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// parseTypeComment recognizes a "# TYPE <name> <kind>" comment line.
+func parseTypeComment(line string) (typ promType, name string, ok bool) {
+	fields := strings.Fields(strings.TrimPrefix(line, "#"))
+	if len(fields) != 3 || fields[0] != "TYPE" {
+		return 0, "", false
+	}
+	switch fields[2] {
+	case "counter":
+		return promCounter, fields[1], true
+	case "gauge":
+		return promGauge, fields[1], true
+	case "histogram":
+		return promHistogram, fields[1], true
+	case "summary":
+		return promSummary, fields[1], true
+	default:
+		return promUntyped, fields[1], true
+	}
+}
+
+// sampleFor resolves the metric family name and its "le"/"quantile"
+// label (if any) into a registered *Metric and builds the Sample.
+func sampleFor(
+	reg *Registry, types map[string]promType,
+	name string, labels map[string]string, value float64, ts *time.Time,
+) (Sample, error) {
+	family := familyName(name, types)
+	typ := types[family]
+
+	metricType := Counter
+	switch typ {
+	case promGauge:
+		metricType = Gauge
+	case promUntyped:
+		metricType = Gauge
+	case promCounter, promHistogram, promSummary:
+		metricType = Counter
+	}
+	// Summary quantiles (as opposed to their _sum/_count lines) report an
+	// observed value rather than a monotonic count, so they're exposed
+	// as a Gauge instead.
+	if typ == promSummary {
+		if _, ok := labels["quantile"]; ok {
+			metricType = Gauge
+		}
+	}
+
+	var metric *Metric
+	var err error
+	if sub, ok := submetricLabel(typ, labels); ok {
+		metric, err = reg.RegisterSubmetric(fmt.Sprintf("%s{%s}", family, sub), metricType)
+	} else {
+		metric, err = reg.Register(name, metricType)
+	}
+	if err != nil {
+		return Sample{}, err
+	}
+
+	t := time.Now()
+	if ts != nil {
+		t = *ts
+	}
+	return Sample{
+		Metric: metric,
+		Tags:   NewSampleTags(labels),
+		Time:   t,
+		Value:  value,
+	}, nil
+}
+
+// familyName strips the well-known "_bucket"/"_sum"/"_count" suffixes
+// Prometheus histograms and summaries add to their base metric name, so
+// samples from the same family resolve to the same family name even
+// though types is keyed by the exact name given on the "# TYPE" line.
+func familyName(name string, types map[string]promType) string {
+	if _, ok := types[name]; ok {
+		return name
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if base := strings.TrimSuffix(name, suffix); base != name {
+			if _, ok := types[base]; ok {
+				return base
+			}
+		}
+	}
+	return name
+}
+
+// submetricLabel returns the "key:value" fragment NewSubmetric expects
+// for a histogram bucket or summary quantile sample, so its name
+// uniquely identifies that one bucket/quantile within the family.
+func submetricLabel(typ promType, labels map[string]string) (string, bool) {
+	switch typ {
+	case promHistogram:
+		if v, ok := labels["le"]; ok {
+			return "le:" + v, true
+		}
+	case promSummary:
+		if v, ok := labels["quantile"]; ok {
+			return "quantile:" + v, true
+		}
+	}
+	return "", false
+}
+
+// parseSampleLine parses one exposition line into its metric name, label
+// set, value and optional millisecond timestamp.
+func parseSampleLine(line string) (name string, labels map[string]string, value float64, ts *time.Time, err error) {
+	rest := line
+	if brace := strings.IndexByte(rest, '{'); brace >= 0 {
+		name = rest[:brace]
+		end, lbls, perr := parseLabels(rest[brace+1:])
+		if perr != nil {
+			return "", nil, 0, nil, perr
+		}
+		labels = lbls
+		rest = strings.TrimSpace(rest[brace+1+end+1:])
+	} else {
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return "", nil, 0, nil, fmt.Errorf("empty line")
+		}
+		name = fields[0]
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, fields[0]))
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", nil, 0, nil, fmt.Errorf("missing value")
+	}
+
+	value, err = parseFloat(fields[0])
+	if err != nil {
+		return "", nil, 0, nil, err
+	}
+
+	if len(fields) > 1 {
+		ms, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return "", nil, 0, nil, err
+		}
+		t := time.Unix(0, ms*int64(time.Millisecond))
+		ts = &t
+	}
+
+	return name, labels, value, ts, nil
+}
+
+// parseFloat maps the exposition format's special float values ("Nan",
+// "NaN", "+Inf", "-Inf") explicitly and leaves every other value to
+// strconv.ParseFloat.
+func parseFloat(s string) (float64, error) {
+	switch s {
+	case "Nan", "NaN":
+		return math.NaN(), nil
+	case "+Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	default:
+		return strconv.ParseFloat(s, 64)
+	}
+}
+
+// parseLabels parses the body of a "{...}" label set, starting just
+// after the opening brace, handling the \\, \" and \n escape sequences
+// the exposition format allows inside quoted label values. It returns
+// the index of the closing '}' relative to the start of body.
+func parseLabels(body string) (end int, labels map[string]string, err error) {
+	labels = map[string]string{}
+
+	i := 0
+	for i < len(body) {
+		for i < len(body) && (body[i] == ',' || body[i] == ' ') {
+			i++
+		}
+		if i < len(body) && body[i] == '}' {
+			return i, labels, nil
+		}
+
+		keyStart := i
+		for i < len(body) && body[i] != '=' {
+			i++
+		}
+		if i >= len(body) {
+			return 0, nil, fmt.Errorf("unterminated label set")
+		}
+		key := strings.TrimSpace(body[keyStart:i])
+		i++ // skip '='
+
+		if i >= len(body) || body[i] != '"' {
+			return 0, nil, fmt.Errorf("expected quoted label value for %q", key)
+		}
+		i++ // skip opening quote
+
+		var value strings.Builder
+		for i < len(body) && body[i] != '"' {
+			if body[i] == '\\' && i+1 < len(body) {
+				switch body[i+1] {
+				case '\\':
+					value.WriteByte('\\')
+				case '"':
+					value.WriteByte('"')
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(body[i+1])
+				}
+				i += 2
+				continue
+			}
+			value.WriteByte(body[i])
+			i++
+		}
+		if i >= len(body) {
+			return 0, nil, fmt.Errorf("unterminated label value for %q", key)
+		}
+		i++ // skip closing quote
+
+		labels[key] = value.String()
+	}
+
+	return 0, nil, fmt.Errorf("unterminated label set")
+}
@@ -0,0 +1,192 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseTextCounterAndGauge(t *testing.T) {
+	input := `# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+plain_gauge 42.5
+`
+	reg := NewRegistry()
+	samples, err := ParseText(strings.NewReader(input), reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("len(samples) = %d, want 2", len(samples))
+	}
+
+	req := samples[0]
+	if req.Metric.Name != "http_requests_total" || req.Metric.Type != Counter {
+		t.Errorf("unexpected metric for http_requests_total: %+v", req.Metric)
+	}
+	if v, ok := req.Tags.Get("method"); !ok || v != "post" {
+		t.Errorf("method tag = %q, %v, want \"post\", true", v, ok)
+	}
+	if req.Value != 1027 {
+		t.Errorf("value = %v, want 1027", req.Value)
+	}
+
+	gauge := samples[1]
+	if gauge.Metric.Type != Gauge {
+		t.Errorf("plain_gauge registered as %v, want Gauge", gauge.Metric.Type)
+	}
+}
+
+func TestParseTextHistogramSubmetrics(t *testing.T) {
+	input := `# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="0.1"} 24054
+http_request_duration_seconds_bucket{le="+Inf"} 144320
+http_request_duration_seconds_sum 53423
+http_request_duration_seconds_count 144320
+`
+	reg := NewRegistry()
+	samples, err := ParseText(strings.NewReader(input), reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 4 {
+		t.Fatalf("len(samples) = %d, want 4", len(samples))
+	}
+
+	parent, ok := reg.Get("http_request_duration_seconds")
+	if !ok {
+		t.Fatal("expected the family name to be registered")
+	}
+	if len(parent.Submetrics) != 2 {
+		t.Fatalf("len(parent.Submetrics) = %d, want 2 (one per le bucket)", len(parent.Submetrics))
+	}
+
+	bucket := samples[0]
+	if bucket.Metric.Sub.Parent != "http_request_duration_seconds" {
+		t.Errorf("bucket sample's Sub.Parent = %q, want the family name", bucket.Metric.Sub.Parent)
+	}
+	if v, ok := bucket.Tags.Get("le"); !ok || v != "0.1" {
+		t.Errorf("le tag = %q, %v, want \"0.1\", true", v, ok)
+	}
+}
+
+func TestParseTextSummaryQuantileIsGauge(t *testing.T) {
+	input := `# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 4773
+rpc_duration_seconds_count 2693
+`
+	reg := NewRegistry()
+	samples, err := ParseText(strings.NewReader(input), reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quantile := samples[0]
+	if quantile.Metric.Type != Gauge {
+		t.Errorf("quantile submetric type = %v, want Gauge", quantile.Metric.Type)
+	}
+	count := samples[1]
+	if count.Metric.Type != Counter {
+		t.Errorf("_count metric type = %v, want Counter", count.Metric.Type)
+	}
+}
+
+func TestParseTextLabelEscapes(t *testing.T) {
+	input := `metric{label="a\\b\"c\nd"} 1
+`
+	reg := NewRegistry()
+	samples, err := ParseText(strings.NewReader(input), reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, ok := samples[0].Tags.Get("label")
+	if !ok {
+		t.Fatal("expected label tag to be present")
+	}
+	if want := "a\\b\"c\nd"; value != want {
+		t.Errorf("label = %q, want %q", value, want)
+	}
+}
+
+func TestParseTextSpecialFloats(t *testing.T) {
+	input := `nan_metric Nan
+pos_inf_metric +Inf
+neg_inf_metric -Inf
+`
+	reg := NewRegistry()
+	samples, err := ParseText(strings.NewReader(input), reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(samples[0].Value) {
+		t.Errorf("nan_metric = %v, want NaN", samples[0].Value)
+	}
+	if !math.IsInf(samples[1].Value, 1) {
+		t.Errorf("pos_inf_metric = %v, want +Inf", samples[1].Value)
+	}
+	if !math.IsInf(samples[2].Value, -1) {
+		t.Errorf("neg_inf_metric = %v, want -Inf", samples[2].Value)
+	}
+}
+
+// TestParseTextConcurrentSubmetricRegistration guards against a data race
+// in submetric registration: several goroutines parsing the same
+// histogram family into the same Registry concurrently must never
+// observe a parent/submetric pair half-linked.
+func TestParseTextConcurrentSubmetricRegistration(t *testing.T) {
+	input := `# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="0.1"} 24054
+http_request_duration_seconds_bucket{le="+Inf"} 144320
+http_request_duration_seconds_sum 53423
+http_request_duration_seconds_count 144320
+`
+	reg := NewRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ParseText(strings.NewReader(input), reg); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	parent, ok := reg.Get("http_request_duration_seconds")
+	if !ok {
+		t.Fatal("expected the family name to be registered")
+	}
+	if len(parent.Submetrics) != 2 {
+		t.Fatalf("len(parent.Submetrics) = %d, want 2 (one per le bucket)", len(parent.Submetrics))
+	}
+}
+
+func TestParseTextMalformedLine(t *testing.T) {
+	reg := NewRegistry()
+	_, err := ParseText(strings.NewReader("metric{unterminated\n"), reg)
+	if err == nil {
+		t.Fatal("expected an error for an unterminated label set")
+	}
+}
@@ -0,0 +1,330 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package prometheus implements a k6 Collector that exposes metrics in the
+// Prometheus text exposition format over HTTP, so that a running k6 instance
+// can be scraped by an existing Prometheus server instead of pushing samples
+// to InfluxDB.
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+// Default configuration values.
+const (
+	defaultAddr = ":5656"
+	defaultPath = "/metrics"
+)
+
+// Config holds the configuration for the Prometheus collector.
+type Config struct {
+	// Addr is the address the /metrics endpoint is served on.
+	Addr string
+	// AllowedTags is an allow-list of SampleTags keys that are translated
+	// into Prometheus labels. Tags not in this list are dropped, to avoid
+	// unbounded label cardinality. A nil/empty list means no tags are
+	// exported as labels.
+	AllowedTags []string
+}
+
+// Collector is a k6 Collector that keeps an in-memory Prometheus registry
+// up to date with incoming samples and serves it over HTTP.
+type Collector struct {
+	config   Config
+	registry *prometheus.Registry
+	server   *http.Server
+
+	mutex      sync.Mutex
+	collectors map[string]metricCollector
+}
+
+// metricCollector is the per-metric bundle of Prometheus vectors a sample
+// stream for a single k6 metric is mapped onto.
+type metricCollector interface {
+	// Update records a single k6 sample against the underlying Prometheus
+	// collector(s).
+	Update(sample stats.Sample, labels prometheus.Labels)
+}
+
+// NewCollector returns a new Collector for the given configuration. It
+// satisfies k6's Collector interface.
+func NewCollector(conf Config) (*Collector, error) {
+	if conf.Addr == "" {
+		conf.Addr = defaultAddr
+	}
+
+	registry := prometheus.NewRegistry()
+	mux := http.NewServeMux()
+	mux.Handle(defaultPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	return &Collector{
+		config:     conf,
+		registry:   registry,
+		server:     &http.Server{Addr: conf.Addr, Handler: mux},
+		collectors: map[string]metricCollector{},
+	}, nil
+}
+
+// Init implements the Collector interface; nothing to do until samples
+// start arriving, since Prometheus collectors are created lazily per metric.
+func (c *Collector) Init() error {
+	return nil
+}
+
+// Link returns the URL the /metrics endpoint can be scraped at.
+func (c *Collector) Link() string {
+	return "http://" + c.config.Addr + defaultPath
+}
+
+// String implements fmt.Stringer.
+func (c *Collector) String() string {
+	return "prometheus (" + c.Link() + ")"
+}
+
+// Run starts the HTTP server and blocks until ctx is cancelled.
+func (c *Collector) Run(ctx context.Context) {
+	go func() {
+		if err := c.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).Error("Prometheus: HTTP server error")
+		}
+	}()
+
+	<-ctx.Done()
+	_ = c.server.Close()
+}
+
+// Collect implements the Collector interface, translating a batch of k6
+// samples into updates of the underlying Prometheus collectors.
+func (c *Collector) Collect(samples []stats.Sample) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, sample := range samples {
+		mc, ok := c.collectors[sample.Metric.Name]
+		if !ok {
+			mc = c.newMetricCollector(sample.Metric)
+			c.collectors[sample.Metric.Name] = mc
+		}
+		mc.Update(sample, c.labelsFor(sample.Tags))
+	}
+}
+
+// labelsFor filters a sample's tags down to the configured allow-list and
+// turns them into prometheus.Labels.
+func (c *Collector) labelsFor(tags *stats.SampleTags) prometheus.Labels {
+	labels := make(prometheus.Labels, len(c.config.AllowedTags))
+	for _, key := range c.config.AllowedTags {
+		value, _ := tags.Get(key)
+		labels[sanitizeLabelName(key)] = value
+	}
+	return labels
+}
+
+func (c *Collector) newMetricCollector(metric *stats.Metric) metricCollector {
+	name := sanitizeMetricName(metric.Name)
+	labelNames := make([]string, len(c.config.AllowedTags))
+	for i, key := range c.config.AllowedTags {
+		labelNames[i] = sanitizeLabelName(key)
+	}
+	sort.Strings(labelNames)
+
+	switch metric.Type {
+	case stats.Counter:
+		vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name}, labelNames)
+		c.registry.MustRegister(vec)
+		return &counterCollector{vec: vec}
+	case stats.Gauge:
+		vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name}, labelNames)
+		c.registry.MustRegister(vec)
+		return &gaugeCollector{vec: vec, contains: metric.Contains}
+	case stats.Rate:
+		// A Rate is exposed as a gauge holding the ratio of non-zero
+		// samples seen so far, since Prometheus has no native concept
+		// of a rate metric.
+		vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name}, labelNames)
+		c.registry.MustRegister(vec)
+		return &rateCollector{vec: vec}
+	case stats.Trend, stats.Histogram:
+		// Trend and Histogram metrics already maintain their own running
+		// aggregate in metric.Sink (a TrendSink/StreamingTrendSink or a
+		// HistogramSink), computed over every sample for the metric
+		// regardless of tags; re-deriving percentiles/buckets from the
+		// raw samples here would duplicate that work and produce numbers
+		// that don't match k6's own summary output. That also means the
+		// aggregate can't meaningfully be broken out per label set the
+		// way Counter/Gauge/Rate samples are - every label combination
+		// would report the exact same whole-run numbers - so it's
+		// published as a single unlabeled gauge per Format() key instead
+		// of a vector, e.g. "min"/"max"/"p90"/... for a Trend,
+		// "count"/"sum"/"bucket_<le>" for a Histogram.
+		return newSinkCollector(c.registry, name)
+	default:
+		// Unknown/unmapped metric types are silently dropped rather than
+		// failing the whole collector, mirroring how other k6 output
+		// collectors skip metrics they don't understand.
+		return &noopCollector{}
+	}
+}
+
+type counterCollector struct {
+	vec *prometheus.CounterVec
+}
+
+func (cc *counterCollector) Update(sample stats.Sample, labels prometheus.Labels) {
+	cc.vec.With(labels).Add(scale(sample))
+}
+
+type gaugeCollector struct {
+	vec      *prometheus.GaugeVec
+	contains stats.ValueType
+}
+
+func (gc *gaugeCollector) Update(sample stats.Sample, labels prometheus.Labels) {
+	gc.vec.With(labels).Set(scaleValue(sample.Value, gc.contains))
+}
+
+type rateCollector struct {
+	vec *prometheus.GaugeVec
+
+	mutex sync.Mutex
+	count map[string]*rateCount
+}
+
+type rateCount struct {
+	total, nonZero float64
+}
+
+func (rc *rateCollector) Update(sample stats.Sample, labels prometheus.Labels) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if rc.count == nil {
+		rc.count = map[string]*rateCount{}
+	}
+	key := labelsKey(labels)
+	rcv, ok := rc.count[key]
+	if !ok {
+		rcv = &rateCount{}
+		rc.count[key] = rcv
+	}
+	rcv.total++
+	if sample.Value != 0 {
+		rcv.nonZero++
+	}
+	rc.vec.With(labels).Set(rcv.nonZero / rcv.total)
+}
+
+// sinkCollector exports a metric whose Sink already computes an
+// aggregate shape (Trend's min/max/percentiles, Histogram's bucket
+// counts) rather than a single scalar. It publishes one unlabeled gauge
+// per key in Sink.Format(), creating them lazily as new keys are seen.
+// Unlike counterCollector/gaugeCollector/rateCollector it ignores the
+// sample's labels: the Sink aggregates over every sample for the metric
+// regardless of tags, so there's no per-label value to report.
+type sinkCollector struct {
+	registry *prometheus.Registry
+	name     string
+
+	mutex  sync.Mutex
+	gauges map[string]prometheus.Gauge
+}
+
+func newSinkCollector(registry *prometheus.Registry, name string) *sinkCollector {
+	return &sinkCollector{
+		registry: registry,
+		name:     name,
+		gauges:   map[string]prometheus.Gauge{},
+	}
+}
+
+func (sc *sinkCollector) Update(sample stats.Sample, _ prometheus.Labels) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	for key, value := range sample.Metric.Sink.Format(0) {
+		gauge, ok := sc.gauges[key]
+		if !ok {
+			gauge = prometheus.NewGauge(prometheus.GaugeOpts{Name: sc.name + "_" + key})
+			sc.registry.MustRegister(gauge)
+			sc.gauges[key] = gauge
+		}
+		gauge.Set(value)
+	}
+}
+
+type noopCollector struct{}
+
+func (noopCollector) Update(stats.Sample, prometheus.Labels) {}
+
+// scale converts a sample's value to the unit Prometheus expects, scaling
+// nanosecond durations down to seconds.
+func scale(sample stats.Sample) float64 {
+	return scaleValue(sample.Value, sample.Metric.Contains)
+}
+
+func scaleValue(v float64, contains stats.ValueType) float64 {
+	if contains == stats.Time {
+		return v / float64(time.Second)
+	}
+	return v
+}
+
+// labelsKey builds a stable string key for a label set, so per-label-set
+// state (like rateCollector's running totals) can be looked up in a map.
+func labelsKey(labels prometheus.Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(labels[name])
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+var invalidNameChars = strings.NewReplacer(".", "_", "-", "_", "{", "_", "}", "_")
+
+func sanitizeMetricName(name string) string {
+	return "k6_" + invalidNameChars.Replace(name)
+}
+
+func sanitizeLabelName(name string) string {
+	return invalidNameChars.Replace(name)
+}
+
+var _ fmt.Stringer = (*Collector)(nil)
@@ -0,0 +1,142 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+// fakeSink is a minimal stats.Sink double so these tests don't depend on
+// any particular Sink implementation's Format() shape.
+type fakeSink struct {
+	format map[string]float64
+}
+
+func (s *fakeSink) Add(stats.Sample) {}
+func (s *fakeSink) Format(time.Duration) map[string]float64 {
+	return s.format
+}
+
+func newCollector(t *testing.T, tags ...string) *Collector {
+	t.Helper()
+	c, err := NewCollector(Config{AllowedTags: tags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCollectorCounter(t *testing.T) {
+	c := newCollector(t, "status")
+	metric := &stats.Metric{Name: "reqs", Type: stats.Counter}
+	tags := stats.NewSampleTags(map[string]string{"status": "200"})
+
+	c.Collect([]stats.Sample{
+		{Metric: metric, Tags: tags, Value: 1},
+		{Metric: metric, Tags: tags, Value: 2},
+	})
+
+	mc := c.collectors["reqs"].(*counterCollector)
+	got := testutil.ToFloat64(mc.vec.With(prometheus.Labels{"status": "200"}))
+	if got != 3 {
+		t.Errorf("counter value = %v, want 3", got)
+	}
+}
+
+func TestCollectorGauge(t *testing.T) {
+	c := newCollector(t)
+	metric := &stats.Metric{Name: "vus", Type: stats.Gauge}
+
+	c.Collect([]stats.Sample{{Metric: metric, Tags: stats.NewSampleTags(nil), Value: 10}})
+	c.Collect([]stats.Sample{{Metric: metric, Tags: stats.NewSampleTags(nil), Value: 7}})
+
+	mc := c.collectors["vus"].(*gaugeCollector)
+	got := testutil.ToFloat64(mc.vec.With(prometheus.Labels{}))
+	if got != 7 {
+		t.Errorf("gauge value = %v, want 7 (last value wins)", got)
+	}
+}
+
+func TestCollectorRate(t *testing.T) {
+	c := newCollector(t)
+	metric := &stats.Metric{Name: "checks", Type: stats.Rate}
+
+	c.Collect([]stats.Sample{
+		{Metric: metric, Tags: stats.NewSampleTags(nil), Value: 1},
+		{Metric: metric, Tags: stats.NewSampleTags(nil), Value: 0},
+		{Metric: metric, Tags: stats.NewSampleTags(nil), Value: 1},
+		{Metric: metric, Tags: stats.NewSampleTags(nil), Value: 1},
+	})
+
+	mc := c.collectors["checks"].(*rateCollector)
+	got := testutil.ToFloat64(mc.vec.With(prometheus.Labels{}))
+	if got != 0.75 {
+		t.Errorf("rate value = %v, want 0.75", got)
+	}
+}
+
+// TestCollectorSinkIgnoresLabels guards against sinkCollector publishing
+// the same whole-metric aggregate once per label set: a Trend/Histogram
+// with samples carrying different tags must still only export a single,
+// unlabeled series per Sink.Format() key.
+func TestCollectorSinkIgnoresLabels(t *testing.T) {
+	c := newCollector(t, "status")
+	sink := &fakeSink{format: map[string]float64{"med": 12.5}}
+	metric := &stats.Metric{Name: "http_req_duration", Type: stats.Trend, Sink: sink}
+
+	c.Collect([]stats.Sample{
+		{Metric: metric, Tags: stats.NewSampleTags(map[string]string{"status": "200"}), Value: 1},
+		{Metric: metric, Tags: stats.NewSampleTags(map[string]string{"status": "500"}), Value: 1},
+	})
+
+	mc := c.collectors["http_req_duration"].(*sinkCollector)
+	if n := testutil.CollectAndCount(mc.gauges["med"]); n != 1 {
+		t.Fatalf("got %d series for the med gauge, want exactly 1 (no per-label fan-out)", n)
+	}
+	if got := testutil.ToFloat64(mc.gauges["med"]); got != 12.5 {
+		t.Errorf("med value = %v, want 12.5", got)
+	}
+}
+
+func TestLabelsForFiltersToAllowList(t *testing.T) {
+	c := newCollector(t, "status")
+	tags := stats.NewSampleTags(map[string]string{"status": "200", "unlisted": "x"})
+
+	labels := c.labelsFor(tags)
+	if len(labels) != 1 || labels["status"] != "200" {
+		t.Errorf("labelsFor() = %v, want only the allow-listed \"status\" tag", labels)
+	}
+}
+
+func TestSanitizeNames(t *testing.T) {
+	if got, want := sanitizeMetricName("http.req-duration{p90}"), "k6_http_req_duration_p90_"; got != want {
+		t.Errorf("sanitizeMetricName() = %q, want %q", got, want)
+	}
+	if got, want := sanitizeLabelName("my-tag"), "my_tag"; got != want {
+		t.Errorf("sanitizeLabelName() = %q, want %q", got, want)
+	}
+}
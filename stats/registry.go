@@ -0,0 +1,231 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Names of the built-in metrics every k6 script has available, kept as
+// constants instead of the string literals that used to be scattered
+// across the engine, JS runtime and collectors.
+const (
+	VUsName               = "vus"
+	VUsMaxName            = "vus_max"
+	IterationsName        = "iterations"
+	IterationDurationName = "iteration_duration"
+	DroppedIterationsName = "dropped_iterations"
+
+	ChecksName = "checks"
+
+	HTTPReqsName              = "http_reqs"
+	HTTPReqDurationName       = "http_req_duration"
+	HTTPReqBlockedName        = "http_req_blocked"
+	HTTPReqConnectingName     = "http_req_connecting"
+	HTTPReqTLSHandshakingName = "http_req_tls_handshaking"
+	HTTPReqSendingName        = "http_req_sending"
+	HTTPReqWaitingName        = "http_req_waiting"
+	HTTPReqReceivingName      = "http_req_receiving"
+
+	DataSentName     = "data_sent"
+	DataReceivedName = "data_received"
+)
+
+// ErrMetricsTypeMismatch is returned by Register when a metric name is
+// registered again with a MetricType or ValueType that differs from the
+// one it was first registered with.
+var ErrMetricsTypeMismatch = fmt.Errorf("metric already registered with a different type")
+
+// Registry owns the lifecycle of a set of Metrics. It replaces the old
+// pattern of constructing *Metric values with the package-level New()
+// and stashing them in ad-hoc globals, which made it impossible to run
+// more than one independent k6 instance in the same process.
+//
+// Submetrics are registered under their full "name{tag:value,...}"
+// string, as produced by NewSubmetric, so two submetrics of the same
+// parent with different tag filters naturally get distinct registry
+// entries - there's no separate tag-based fingerprint to maintain.
+type Registry struct {
+	mutex   sync.RWMutex
+	metrics map[string]*Metric
+}
+
+// NewRegistry returns a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*Metric)}
+}
+
+// Register looks up name, returning the existing metric if one is
+// already registered with the same MetricType and ValueType. Otherwise
+// it creates, stores and returns a new one. It returns
+// ErrMetricsTypeMismatch if name is registered under a conflicting type.
+func (r *Registry) Register(name string, typ MetricType, t ...ValueType) (*Metric, error) {
+	vt := Default
+	if len(t) > 0 {
+		vt = t[0]
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.registerSink(name, typ, vt, nil)
+}
+
+// registerSink does the actual lookup-or-create work shared by Register
+// and the typed constructors that need a non-default Sink, like
+// NewHistogram. A nil sink defers to New()'s default Sink for typ. The
+// caller must hold r.mutex.
+func (r *Registry) registerSink(name string, typ MetricType, vt ValueType, sink Sink) (*Metric, error) {
+	if existing, ok := r.metrics[name]; ok {
+		if existing.Type != typ || existing.Contains != vt {
+			return nil, fmt.Errorf("%w: %s is already registered as %s/%s, not %s/%s",
+				ErrMetricsTypeMismatch, name, existing.Type, existing.Contains, typ, vt)
+		}
+		return existing, nil
+	}
+
+	var m *Metric
+	if sink != nil {
+		m = NewWithSink(name, typ, sink, vt)
+	} else {
+		m = New(name, typ, vt)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("invalid metric type %s for %s", typ, name)
+	}
+	r.metrics[name] = m
+	return m, nil
+}
+
+// familyMetricType is the MetricType a submetric's parent family metric
+// is registered with by RegisterSubmetric. The family metric is never
+// sampled directly - its samples always land on one of its Submetrics -
+// so its type is just a fixed placeholder rather than something derived
+// from the samples seen.
+const familyMetricType = Gauge
+
+// RegisterSubmetric resolves name (e.g. "http_req_duration{le:0.5}") via
+// NewSubmetric - the same machinery the rest of k6 uses for tag-filtered
+// views - registering both the submetric and its parent family metric,
+// and linking them through Metric.Sub/Metric.Submetrics so anything
+// walking the parent's Submetrics (threshold inheritance, summary
+// grouping) sees these the same way it would any other submetric.
+//
+// Both registrations and the linking happen under a single lock, so a
+// concurrent caller registering the same submetric never observes
+// metric.Sub/parent.Submetrics half-wired.
+func (r *Registry) RegisterSubmetric(name string, typ MetricType) (*Metric, error) {
+	parentName, sm := NewSubmetric(name)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	parent, err := r.registerSink(parentName, familyMetricType, Default, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	metric, err := r.registerSink(name, typ, Default, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if metric.Sub.Parent == "" {
+		sm.Metric = metric
+		metric.Sub = *sm
+		parent.Submetrics = append(parent.Submetrics, sm)
+	}
+
+	return metric, nil
+}
+
+// MustRegister is like Register, but panics instead of returning an
+// error. It's meant for the handful of call sites registering the
+// built-in metrics with names and types that are known at compile time.
+func (r *Registry) MustRegister(name string, typ MetricType, t ...ValueType) *Metric {
+	m, err := r.Register(name, typ, t...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Get returns the metric registered under name, if any.
+func (r *Registry) Get(name string) (*Metric, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	m, ok := r.metrics[name]
+	return m, ok
+}
+
+// Unregister removes name from the registry. It's a no-op if name isn't
+// registered.
+func (r *Registry) Unregister(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.metrics, name)
+}
+
+// Each calls f once for every currently registered metric. f must not
+// call back into the Registry, since Each holds the read lock for its
+// entire run.
+func (r *Registry) Each(f func(m *Metric)) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, m := range r.metrics {
+		f(m)
+	}
+}
+
+// NewCounter registers and returns a Counter metric named name.
+func (r *Registry) NewCounter(name string, t ...ValueType) (*Metric, error) {
+	return r.Register(name, Counter, t...)
+}
+
+// NewGauge registers and returns a Gauge metric named name.
+func (r *Registry) NewGauge(name string, t ...ValueType) (*Metric, error) {
+	return r.Register(name, Gauge, t...)
+}
+
+// NewTrend registers and returns a Trend metric named name.
+func (r *Registry) NewTrend(name string, t ...ValueType) (*Metric, error) {
+	return r.Register(name, Trend, t...)
+}
+
+// NewRate registers and returns a Rate metric named name.
+func (r *Registry) NewRate(name string, t ...ValueType) (*Metric, error) {
+	return r.Register(name, Rate, t...)
+}
+
+// NewHistogram registers and returns a Histogram metric named name, with
+// buckets as its boundaries (see LinearBuckets/ExponentialBuckets). A
+// nil/empty buckets falls back to DefaultHistogramBuckets.
+func (r *Registry) NewHistogram(name string, buckets []float64, t ...ValueType) (*Metric, error) {
+	vt := Default
+	if len(t) > 0 {
+		vt = t[0]
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultHistogramBuckets
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.registerSink(name, Histogram, vt, NewHistogramSink(buckets, vt))
+}
@@ -0,0 +1,89 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegistryRegisterDedup(t *testing.T) {
+	r := NewRegistry()
+
+	a, err := r.NewHistogram("reqs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.NewHistogram("reqs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Error("registering the same name twice should return the same *Metric")
+	}
+}
+
+func TestRegistryRegisterTypeMismatch(t *testing.T) {
+	r := NewRegistry()
+
+	if _, err := r.NewHistogram("reqs", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.NewRate("reqs"); !errors.Is(err, ErrMetricsTypeMismatch) {
+		t.Errorf("got err = %v, want ErrMetricsTypeMismatch", err)
+	}
+}
+
+func TestRegistryGetUnregister(t *testing.T) {
+	r := NewRegistry()
+
+	if _, err := r.NewHistogram("reqs", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Get("reqs"); !ok {
+		t.Fatal("expected reqs to be registered")
+	}
+
+	r.Unregister("reqs")
+	if _, ok := r.Get("reqs"); ok {
+		t.Fatal("expected reqs to be gone after Unregister")
+	}
+}
+
+func TestRegistryEach(t *testing.T) {
+	r := NewRegistry()
+	names := []string{"a", "b", "c"}
+	for _, name := range names {
+		if _, err := r.NewHistogram(name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := map[string]bool{}
+	r.Each(func(m *Metric) {
+		seen[m.Name] = true
+	})
+	for _, name := range names {
+		if !seen[name] {
+			t.Errorf("Each() did not visit %q", name)
+		}
+	}
+}
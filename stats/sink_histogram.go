@@ -0,0 +1,142 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultHistogramBuckets is used by New() when a Histogram metric is
+// created without explicit bucket boundaries. It mirrors Prometheus's
+// classic latency buckets, so it's expressed in seconds - Time-valued
+// metrics (k6's native nanoseconds) are scaled to seconds by Add() to
+// match.
+var DefaultHistogramBuckets = ExponentialBuckets(0.005, 2, 12)
+
+// LinearBuckets returns count bucket boundaries, the first at start and
+// each subsequent one width higher than the last.
+func LinearBuckets(start, width float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start + float64(i)*width
+	}
+	return buckets
+}
+
+// ExponentialBuckets returns count bucket boundaries, the first at start
+// and each subsequent one factor times the last.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// HistogramSink is a low-overhead alternative to TrendSink: instead of
+// retaining every observation (or a compressed summary of them, as
+// StreamingTrendSink does), it keeps a fixed set of bucket counters plus
+// a running sum and count - the classic cumulative-histogram
+// representation also used by Prometheus/OpenMetrics.
+type HistogramSink struct {
+	// upperBounds are the configured bucket boundaries, sorted ascending
+	// and deduplicated, with a trailing +Inf bound appended so every
+	// sample always lands in at least one bucket.
+	upperBounds []float64
+	counts      []int64
+
+	// contains is the ValueType of the metric this sink belongs to. Time
+	// values are stored in k6's native nanoseconds, but bucket bounds
+	// (DefaultHistogramBuckets in particular) are expressed in seconds,
+	// so they're scaled down to seconds before bucketing.
+	contains ValueType
+
+	count int64
+	sum   float64
+}
+
+// NewHistogramSink returns a HistogramSink with the given bucket upper
+// bounds, sorted ascending and deduplicated, for a metric containing
+// values of the given ValueType.
+func NewHistogramSink(bounds []float64, contains ValueType) *HistogramSink {
+	sorted := make([]float64, len(bounds))
+	copy(sorted, bounds)
+	sort.Float64s(sorted)
+
+	deduped := sorted[:0]
+	for i, b := range sorted {
+		if i == 0 || b != deduped[len(deduped)-1] {
+			deduped = append(deduped, b)
+		}
+	}
+
+	if len(deduped) == 0 || deduped[len(deduped)-1] != math.Inf(1) {
+		deduped = append(deduped, math.Inf(1))
+	}
+
+	return &HistogramSink{
+		upperBounds: deduped,
+		counts:      make([]int64, len(deduped)),
+		contains:    contains,
+	}
+}
+
+// Add implements the Sink interface, incrementing every bucket whose
+// upper bound is greater than or equal to the sample's value. The
+// trailing +Inf bound guarantees every sample increments at least one
+// bucket, so sum(buckets) always reaches count.
+func (h *HistogramSink) Add(sample Sample) {
+	value := sample.Value
+	if h.contains == Time {
+		value /= float64(time.Second)
+	}
+
+	h.count++
+	h.sum += value
+
+	for i, bound := range h.upperBounds {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+}
+
+// Format implements the Sink interface, returning the running count and
+// sum plus one "bucket_<le>" entry per configured boundary, including
+// the implicit "bucket_+Inf" overflow bucket.
+func (h *HistogramSink) Format(t time.Duration) map[string]float64 {
+	result := map[string]float64{
+		"count": float64(h.count),
+		"sum":   h.sum,
+	}
+	for i, bound := range h.upperBounds {
+		result[bucketKey(bound)] = float64(h.counts[i])
+	}
+	return result
+}
+
+func bucketKey(upperBound float64) string {
+	return "bucket_" + strconv.FormatFloat(upperBound, 'f', -1, 64)
+}
@@ -0,0 +1,79 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHistogramSinkBuckets(t *testing.T) {
+	h := NewHistogramSink(LinearBuckets(0, 1, 3), Default)
+	h.Add(Sample{Value: 0.5})
+	h.Add(Sample{Value: 1.5})
+	h.Add(Sample{Value: 5})
+
+	f := h.Format(time.Duration(0))
+	if f["count"] != 3 {
+		t.Errorf("count = %v, want 3", f["count"])
+	}
+	if f["sum"] != 7 {
+		t.Errorf("sum = %v, want 7", f["sum"])
+	}
+	if f["bucket_0"] != 0 {
+		t.Errorf("bucket_0 = %v, want 0", f["bucket_0"])
+	}
+	if f["bucket_1"] != 1 {
+		t.Errorf("bucket_1 = %v, want 1", f["bucket_1"])
+	}
+	if f["bucket_2"] != 2 {
+		t.Errorf("bucket_2 = %v, want 2", f["bucket_2"])
+	}
+	if f["bucket_+Inf"] != 3 {
+		t.Errorf("bucket_+Inf = %v, want 3 (every sample, including the one above the last bound)", f["bucket_+Inf"])
+	}
+}
+
+func TestHistogramSinkScalesTimeSamples(t *testing.T) {
+	h := NewHistogramSink(LinearBuckets(0, 1, 2), Time)
+	h.Add(Sample{Value: float64(500 * time.Millisecond)})
+
+	f := h.Format(time.Duration(0))
+	if f["bucket_1"] != 1 {
+		t.Errorf("bucket_1 = %v, want 1 (500ms should scale to 0.5s)", f["bucket_1"])
+	}
+}
+
+func TestHistogramSinkDedupesBounds(t *testing.T) {
+	h := NewHistogramSink([]float64{1, 1, 2, 2, 2, 3}, Default)
+	if len(h.upperBounds) != 4 { // 1, 2, 3, +Inf
+		t.Fatalf("upperBounds = %v, want 4 entries (deduped + trailing +Inf)", h.upperBounds)
+	}
+}
+
+func TestHistogramSinkAlwaysHasInfBound(t *testing.T) {
+	h := NewHistogramSink([]float64{1, 2}, Default)
+	last := h.upperBounds[len(h.upperBounds)-1]
+	if !math.IsInf(last, 1) {
+		t.Fatalf("last bound = %v, want +Inf", last)
+	}
+}
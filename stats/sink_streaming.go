@@ -0,0 +1,231 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// Quantile describes one target rank a StreamingTrendSink keeps a bounded
+// error guarantee for, e.g. {Rank: 0.95, Epsilon: 0.005} asks for the 95th
+// percentile accurate to within 0.5% of the observation count.
+type Quantile struct {
+	Rank    float64
+	Epsilon float64
+}
+
+// DefaultQuantiles are the percentiles StreamingTrendSink tracks when none
+// are supplied explicitly; they mirror the ones TrendSink.Format() reports.
+var DefaultQuantiles = []Quantile{
+	{Rank: 0.50, Epsilon: 0.02},
+	{Rank: 0.90, Epsilon: 0.01},
+	{Rank: 0.95, Epsilon: 0.005},
+	{Rank: 0.99, Epsilon: 0.001},
+}
+
+// compressEvery controls how often StreamingTrendSink merges adjacent
+// tuples; compressing after every insert would be correct but wasteful,
+// so it only runs once this many observations have accumulated since the
+// last pass.
+const compressEvery = 100
+
+// ckmsTuple is one (value, g, delta) entry of the CKMS summary, as
+// described in "Effective Computation of Biased Quantiles over Data
+// Streams" (Cormode, Korn, Muthukrishnan, Srivastava). g is the number of
+// observations represented by this tuple and all those merged into it;
+// delta is the maximum error in its rank.
+type ckmsTuple struct {
+	value float64
+	g     int64
+	delta int64
+}
+
+// StreamingTrendSink is a bounded-memory alternative to TrendSink. Instead
+// of retaining every observation, it keeps a compressed, ordered summary
+// of (value, g, delta) tuples that's enough to answer quantile queries
+// within the configured error bounds, so long-running tests don't grow
+// the sink's memory use with the number of samples seen.
+type StreamingTrendSink struct {
+	quantiles []Quantile
+
+	samples              []ckmsTuple
+	n                    int64
+	insertsSinceCompress int64
+	min, max, sum        float64
+}
+
+// NewStreamingTrendSink returns a StreamingTrendSink tracking the given
+// target quantiles. A nil/empty slice falls back to DefaultQuantiles.
+func NewStreamingTrendSink(quantiles []Quantile) *StreamingTrendSink {
+	if len(quantiles) == 0 {
+		quantiles = DefaultQuantiles
+	}
+	return &StreamingTrendSink{quantiles: quantiles}
+}
+
+// Add implements the Sink interface.
+func (s *StreamingTrendSink) Add(sample Sample) {
+	s.insert(sample.Value)
+}
+
+func (s *StreamingTrendSink) insert(value float64) {
+	if s.n == 0 {
+		s.min, s.max = value, value
+	} else {
+		if value < s.min {
+			s.min = value
+		}
+		if value > s.max {
+			s.max = value
+		}
+	}
+	s.sum += value
+	s.n++
+
+	pos := 0
+	for pos < len(s.samples) && s.samples[pos].value < value {
+		pos++
+	}
+
+	var delta int64
+	switch {
+	case pos == 0 || pos == len(s.samples):
+		// The smallest and largest observations seen so far are kept
+		// exact, so that min/max queries and the tails of the
+		// distribution are never blurred by compression.
+		delta = 0
+	default:
+		delta = int64(s.invariant(float64(pos))) - 1
+		if delta < 0 {
+			delta = 0
+		}
+	}
+
+	tuple := ckmsTuple{value: value, g: 1, delta: delta}
+	s.samples = append(s.samples, ckmsTuple{})
+	copy(s.samples[pos+1:], s.samples[pos:])
+	s.samples[pos] = tuple
+
+	s.insertsSinceCompress++
+	if s.insertsSinceCompress >= compressEvery {
+		s.compress()
+		s.insertsSinceCompress = 0
+	}
+}
+
+// invariant is f(rank, n): the maximum total width (g+delta) a tuple at
+// the given rank may have while still satisfying every target quantile's
+// error bound.
+func (s *StreamingTrendSink) invariant(rank float64) float64 {
+	n := float64(s.n)
+	best := math.Inf(1)
+	for _, q := range s.quantiles {
+		var f float64
+		if rank <= q.Rank*n {
+			f = 2 * q.Epsilon * rank / q.Rank
+		} else {
+			f = 2 * q.Epsilon * (n - rank) / (1 - q.Rank)
+		}
+		if f < best {
+			best = f
+		}
+	}
+	if math.IsInf(best, 1) {
+		return math.MaxFloat64
+	}
+	return best
+}
+
+// compress merges adjacent tuples where doing so can't push any of them
+// outside their allowed rank error, shrinking the summary back towards
+// O(1/epsilon * log(epsilon*n)) entries.
+func (s *StreamingTrendSink) compress() {
+	if len(s.samples) < 2 {
+		return
+	}
+
+	rank := float64(s.samples[0].g)
+	merged := s.samples[:1]
+	for i := 1; i < len(s.samples)-1; i++ {
+		cur := s.samples[i]
+		rank += float64(cur.g)
+
+		prev := &merged[len(merged)-1]
+		if float64(prev.g+cur.g+cur.delta) <= s.invariant(rank) {
+			prev.g += cur.g
+			continue
+		}
+		merged = append(merged, cur)
+	}
+	merged = append(merged, s.samples[len(s.samples)-1])
+	s.samples = merged
+}
+
+// Query returns an estimate of the value at the given rank (0..1): the
+// value of the first tuple in the compressed summary whose maximum rank
+// exceeds the target rank plus half its allowed error (or of the last
+// tuple). It does not interpolate between tuples.
+func (s *StreamingTrendSink) Query(rank float64) float64 {
+	if len(s.samples) == 0 {
+		return 0
+	}
+
+	target := rank * float64(s.n)
+	var g float64
+	for i, t := range s.samples {
+		g += float64(t.g)
+		if g+float64(t.delta) > target+s.invariant(target)/2 || i == len(s.samples)-1 {
+			return t.value
+		}
+	}
+	return s.samples[len(s.samples)-1].value
+}
+
+// Format implements the Sink interface, returning the same shape as
+// TrendSink.Format() so Metric.Summary's JSON output is unaffected by
+// which Sink a Trend metric happens to use.
+func (s *StreamingTrendSink) Format(t time.Duration) map[string]float64 {
+	result := map[string]float64{
+		"min": s.min,
+		"max": s.max,
+		"avg": s.avg(),
+	}
+	for _, q := range s.quantiles {
+		result[quantileKey(q.Rank)] = s.Query(q.Rank)
+	}
+	return result
+}
+
+func (s *StreamingTrendSink) avg() float64 {
+	if s.n == 0 {
+		return 0
+	}
+	return s.sum / float64(s.n)
+}
+
+func quantileKey(rank float64) string {
+	if rank == 0.5 {
+		return "med"
+	}
+	return "p" + strconv.FormatFloat(rank*100, 'f', -1, 64)
+}
@@ -0,0 +1,90 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestStreamingTrendSinkQuantiles(t *testing.T) {
+	s := NewStreamingTrendSink(nil)
+	for i := 1; i <= 1000; i++ {
+		s.Add(Sample{Value: float64(i)})
+	}
+
+	f := s.Format(time.Duration(0))
+	if f["min"] != 1 {
+		t.Errorf("min = %v, want 1", f["min"])
+	}
+	if f["max"] != 1000 {
+		t.Errorf("max = %v, want 1000", f["max"])
+	}
+
+	const errorMargin = 20 // generous, since this is an approximate estimator
+	if diff := f["med"] - 500; diff < -errorMargin || diff > errorMargin {
+		t.Errorf("med = %v, want ~500", f["med"])
+	}
+	if diff := f["p99"] - 990; diff < -errorMargin || diff > errorMargin {
+		t.Errorf("p99 = %v, want ~990", f["p99"])
+	}
+}
+
+func TestStreamingTrendSinkFormatShape(t *testing.T) {
+	s := NewStreamingTrendSink([]Quantile{{Rank: 0.5, Epsilon: 0.01}})
+	s.Add(Sample{Value: 1})
+
+	f := s.Format(time.Duration(0))
+	for _, key := range []string{"min", "max", "avg", "med"} {
+		if _, ok := f[key]; !ok {
+			t.Errorf("Format() missing key %q, got %v", key, f)
+		}
+	}
+}
+
+// TestStreamingTrendSinkBoundedSize guards against the compressed summary
+// degenerating into an O(n) structure: with invariant() enforcing each
+// target quantile's error bound, compress() should keep the tuple count
+// to roughly O(1/epsilon * log(epsilon*n)) regardless of how many
+// observations are inserted.
+func TestStreamingTrendSinkBoundedSize(t *testing.T) {
+	s := NewStreamingTrendSink(nil)
+	rng := rand.New(rand.NewSource(1))
+
+	const n = 200000
+	for i := 0; i < n; i++ {
+		s.Add(Sample{Value: rng.Float64() * 1000})
+	}
+
+	const maxSamples = 10000 // generously above the expected bound, well below linear growth
+	if len(s.samples) > maxSamples {
+		t.Errorf("len(s.samples) = %d after %d inserts, want <= %d (summary should stay bounded, not grow linearly)", len(s.samples), n, maxSamples)
+	}
+}
+
+func TestStreamingTrendSinkEmpty(t *testing.T) {
+	s := NewStreamingTrendSink(nil)
+	f := s.Format(time.Duration(0))
+	if f["min"] != 0 || f["max"] != 0 || f["avg"] != 0 {
+		t.Errorf("empty sink should format to zeroes, got %v", f)
+	}
+}
@@ -32,10 +32,11 @@ import (
 )
 
 const (
-	counterString = `"counter"`
-	gaugeString   = `"gauge"`
-	trendString   = `"trend"`
-	rateString    = `"rate"`
+	counterString   = `"counter"`
+	gaugeString     = `"gauge"`
+	trendString     = `"trend"`
+	rateString      = `"rate"`
+	histogramString = `"histogram"`
 
 	defaultString = `"default"`
 	timeString    = `"time"`
@@ -44,10 +45,11 @@ const (
 
 // Possible values for MetricType.
 const (
-	Counter = MetricType(iota) // A counter that sums its data points
-	Gauge                      // A gauge that displays the latest value
-	Trend                      // A trend, min/max/avg/med are interesting
-	Rate                       // A rate, displays % of values that aren't 0
+	Counter   = MetricType(iota) // A counter that sums its data points
+	Gauge                        // A gauge that displays the latest value
+	Trend                        // A trend, min/max/avg/med are interesting
+	Rate                         // A rate, displays % of values that aren't 0
+	Histogram                    // A histogram, bucketed counts of observations
 )
 
 // Possible values for ValueType.
@@ -77,6 +79,8 @@ func (t MetricType) MarshalJSON() ([]byte, error) {
 		return []byte(trendString), nil
 	case Rate:
 		return []byte(rateString), nil
+	case Histogram:
+		return []byte(histogramString), nil
 	default:
 		return nil, ErrInvalidMetricType
 	}
@@ -93,6 +97,8 @@ func (t *MetricType) UnmarshalJSON(data []byte) error {
 		*t = Trend
 	case rateString:
 		*t = Rate
+	case histogramString:
+		*t = Histogram
 	default:
 		return ErrInvalidMetricType
 	}
@@ -110,6 +116,8 @@ func (t MetricType) String() string {
 		return trendString
 	case Rate:
 		return rateString
+	case Histogram:
+		return histogramString
 	default:
 		return "[INVALID]"
 	}
@@ -291,12 +299,34 @@ func New(name string, typ MetricType, t ...ValueType) *Metric {
 		sink = &TrendSink{}
 	case Rate:
 		sink = &RateSink{}
+	case Histogram:
+		sink = NewHistogramSink(DefaultHistogramBuckets, vt)
 	default:
 		return nil
 	}
 	return &Metric{Name: name, Type: typ, Contains: vt, Sink: sink}
 }
 
+// NewWithSink is like New, but registers the metric with the given Sink
+// instead of the type's default one. It exists so alternative Sink
+// implementations, like StreamingTrendSink, can be opted into at
+// registration time without changing every New() call site.
+func NewWithSink(name string, typ MetricType, sink Sink, t ...ValueType) *Metric {
+	vt := Default
+	if len(t) > 0 {
+		vt = t[0]
+	}
+	return &Metric{Name: name, Type: typ, Contains: vt, Sink: sink}
+}
+
+// NewStreamingTrend is a convenience wrapper around NewWithSink that
+// registers a Trend metric backed by a StreamingTrendSink tracking
+// DefaultQuantiles, for use where retaining every observation in memory
+// (as the default TrendSink does) is too expensive.
+func NewStreamingTrend(name string, t ...ValueType) *Metric {
+	return NewWithSink(name, Trend, NewStreamingTrendSink(DefaultQuantiles), t...)
+}
+
 func (m *Metric) HumanizeValue(v float64) string {
 	switch m.Type {
 	case Rate: